@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// ctlSockBackend is the subset of a mounted filesystem's functionality the
+// control socket exposes. Both pathfs_frontend and fusefrontend_reverse
+// implement it.
+type ctlSockBackend interface {
+	EncryptPath(relPath string) (string, error)
+	DecryptPath(relPath string) (string, error)
+	// Stats returns a handful of backend-specific key/value facts (cipherdir,
+	// whether plaintext names are on, ...) to fold into the "Stats" response.
+	Stats() map[string]string
+}
+
+// ctlSockStart and the two counters below track request traffic served over
+// the lifetime of the mount, so a "Stats" request can report something more
+// useful than a hardcoded "ok".
+var (
+	ctlSockStart        = timeNowUnixNano()
+	ctlSockEncryptCount int64
+	ctlSockDecryptCount int64
+)
+
+// ctlSockRequest is the union of every request the control socket
+// understands; exactly one field is expected to be set per request.
+type ctlSockRequest struct {
+	EncryptPath string
+	DecryptPath string
+	Stats       bool
+	Unmount     bool
+}
+
+type ctlSockResponse struct {
+	Result    string              `json:"Result,omitempty"`
+	Stats     *ctlSockStatsResult `json:"Stats,omitempty"`
+	ErrorText string              `json:"ErrorText,omitempty"`
+}
+
+// ctlSockStatsResult is the payload returned for a "Stats" request.
+type ctlSockStatsResult struct {
+	UptimeSeconds   float64           `json:"UptimeSeconds"`
+	EncryptPathReqs int64             `json:"EncryptPathRequests"`
+	DecryptPathReqs int64             `json:"DecryptPathRequests"`
+	Backend         map[string]string `json:"Backend"`
+}
+
+// serveCtlSock listens on the Unix domain socket at "sockPath" and answers
+// one JSON request per connection, until the mount is torn down (srv.Serve()
+// returns, in main()'s goroutine). It is intentionally connection-per-request
+// rather than long-lived, to keep client code trivial ("echo ... | nc -U").
+func serveCtlSock(sockPath string, backend ctlSockBackend, srv *fuse.Server) error {
+	os.Remove(sockPath)
+	l, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer l.Close()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go handleCtlSockConn(conn, backend, srv)
+		}
+	}()
+	return nil
+}
+
+func handleCtlSockConn(conn net.Conn, backend ctlSockBackend, srv *fuse.Server) {
+	defer conn.Close()
+	var req ctlSockRequest
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(ctlSockResponse{ErrorText: err.Error()})
+		return
+	}
+
+	var resp ctlSockResponse
+	switch {
+	case req.EncryptPath != "":
+		atomic.AddInt64(&ctlSockEncryptCount, 1)
+		cPath, err := backend.EncryptPath(req.EncryptPath)
+		if err != nil {
+			resp.ErrorText = err.Error()
+		} else {
+			resp.Result = cPath
+		}
+	case req.DecryptPath != "":
+		atomic.AddInt64(&ctlSockDecryptCount, 1)
+		pPath, err := backend.DecryptPath(req.DecryptPath)
+		if err != nil {
+			resp.ErrorText = err.Error()
+		} else {
+			resp.Result = pPath
+		}
+	case req.Stats:
+		resp.Stats = &ctlSockStatsResult{
+			UptimeSeconds:   time.Since(time.Unix(0, ctlSockStart)).Seconds(),
+			EncryptPathReqs: atomic.LoadInt64(&ctlSockEncryptCount),
+			DecryptPathReqs: atomic.LoadInt64(&ctlSockDecryptCount),
+			Backend:         backend.Stats(),
+		}
+	case req.Unmount:
+		if err := srv.Unmount(); err != nil {
+			resp.ErrorText = err.Error()
+		} else {
+			resp.Result = "unmounted"
+		}
+	default:
+		resp.ErrorText = "empty or unrecognized request"
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// idleMonitorFS wraps a fuse.RawFileSystem and records the time of the last
+// incoming request, so idleMonitor can tell whether the mount has been
+// quiet for long enough to auto-unmount.
+type idleMonitorFS struct {
+	fuse.RawFileSystem
+	// lastActivity holds a UnixNano timestamp, updated with atomic
+	// operations since FUSE requests arrive on many goroutines at once.
+	lastActivity int64
+}
+
+func newIdleMonitorFS(rfs fuse.RawFileSystem) *idleMonitorFS {
+	return &idleMonitorFS{
+		RawFileSystem: rfs,
+		lastActivity:  timeNowUnixNano(),
+	}
+}
+
+func (fs *idleMonitorFS) touch() {
+	atomic.StoreInt64(&fs.lastActivity, timeNowUnixNano())
+}
+
+// The overrides below cover the methods the kernel sends for ordinary
+// read/write/list traffic. Anything else (xattrs, locking, ...) still goes
+// straight to the embedded fuse.RawFileSystem and simply isn't counted as
+// activity - acceptable, since -idle only needs to notice "someone is
+// actively using this mount", not every possible syscall.
+
+func (fs *idleMonitorFS) Lookup(header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	fs.touch()
+	return fs.RawFileSystem.Lookup(header, name, out)
+}
+
+func (fs *idleMonitorFS) GetAttr(input *fuse.GetAttrIn, out *fuse.AttrOut) fuse.Status {
+	fs.touch()
+	return fs.RawFileSystem.GetAttr(input, out)
+}
+
+func (fs *idleMonitorFS) Open(input *fuse.OpenIn, out *fuse.OpenOut) fuse.Status {
+	fs.touch()
+	return fs.RawFileSystem.Open(input, out)
+}
+
+func (fs *idleMonitorFS) Read(input *fuse.ReadIn, buf []byte) (fuse.ReadResult, fuse.Status) {
+	fs.touch()
+	return fs.RawFileSystem.Read(input, buf)
+}
+
+func (fs *idleMonitorFS) Write(input *fuse.WriteIn, data []byte) (uint32, fuse.Status) {
+	fs.touch()
+	return fs.RawFileSystem.Write(input, data)
+}
+
+func (fs *idleMonitorFS) ReadDir(input *fuse.ReadIn, l *fuse.DirEntryList) fuse.Status {
+	fs.touch()
+	return fs.RawFileSystem.ReadDir(input, l)
+}
+
+func (fs *idleMonitorFS) idleFor() time.Duration {
+	last := atomic.LoadInt64(&fs.lastActivity)
+	return time.Since(time.Unix(0, last))
+}
+
+func timeNowUnixNano() int64 {
+	return time.Now().UnixNano()
+}
+
+// startIdleMonitor polls "fs" every idle/4 (but no more often than once a
+// second) and unmounts "srv" once none of the requests idleMonitorFS counts
+// has come in for "idle".
+//
+// A polling loop is simpler and safer than hooking every single
+// RawFileSystem method with touch() calls; -idle is meant for "forgot to
+// unmount my laptop's backup mount", not split-second precision.
+func startIdleMonitor(fs *idleMonitorFS, srv *fuse.Server, idle time.Duration) {
+	interval := idle / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	go func() {
+		for {
+			time.Sleep(interval)
+			if fs.idleFor() >= idle {
+				Info.Printf("Idle for %v, unmounting\n", idle)
+				err := srv.Unmount()
+				if err != nil {
+					Info.Printf("Idle unmount failed: %v\n", err)
+					continue
+				}
+				return
+			}
+		}
+	}()
+}
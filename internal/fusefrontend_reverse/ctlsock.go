@@ -0,0 +1,31 @@
+package fusefrontend_reverse
+
+// EncryptPath translates a plaintext-relative path into the path it shows up
+// under in the encrypted view. Exported for the "-ctlsock" control socket,
+// which lets external tooling do this translation without re-deriving keys.
+func (rfs *reverseFS) EncryptPath(relPath string) (string, error) {
+	return rfs.encryptPath(relPath)
+}
+
+// DecryptPath is the inverse of EncryptPath.
+func (rfs *reverseFS) DecryptPath(relPath string) (string, error) {
+	return rfs.decryptPath(relPath)
+}
+
+// Stats reports a few facts about this reverse mount for the "-ctlsock"
+// "Stats" request.
+func (rfs *reverseFS) Stats() map[string]string {
+	return map[string]string{
+		"Mode":           "reverse",
+		"Cipherdir":      rfs.args.Cipherdir,
+		"PlaintextNames": boolString(rfs.args.PlaintextNames),
+		"AESSIV":         boolString(rfs.args.AESSIV),
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,123 @@
+package fusefrontend_reverse
+
+import (
+	"io"
+	"os"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+
+	"github.com/rfjakob/gocryptfs/internal/contentenc"
+)
+
+// reverseHeaderLen is the size of the per-file header reverse mode
+// synthesizes at ciphertext offset 0: a 2-byte version plus the 16-byte
+// fileID. A forward mount reading through the reverse mount relies on this
+// header being there, exactly like it would be for a file gocryptfs itself
+// created - contentEnc.PlainSizeToCipherSize() already counts these bytes,
+// so GetAttr and Read agree on the file's size.
+const reverseHeaderLen = 2 + 16
+
+var reverseHeaderVersion = [2]byte{0x00, 0x02}
+
+// reverseFile wraps a read-only *os.File open on the plaintext side and
+// encrypts the requested byte range on the fly, one ciphertext block at a
+// time. Nothing is ever written back to the plaintext file.
+type reverseFile struct {
+	nodefs.File
+	fd *os.File
+	// fileID is derived deterministically from the plaintext file's inode
+	// number (see deriveFileID) so that re-mounting the same tree produces
+	// byte-identical ciphertext.
+	fileID     []byte
+	contentEnc *contentenc.ContentEnc
+}
+
+// NewFile wraps "fd" into a nodefs.File that serves encrypted content
+func NewFile(fd *os.File, contentEnc *contentenc.ContentEnc, fileID []byte) (nodefs.File, fuse.Status) {
+	return &reverseFile{
+		File:       nodefs.NewDefaultFile(),
+		fd:         fd,
+		fileID:     fileID,
+		contentEnc: contentEnc,
+	}, fuse.OK
+}
+
+// header returns the synthetic 18-byte file header that would normally be
+// stored at the start of a gocryptfs file, so a forward mount layered on top
+// of the reverse mount sees the fileID it needs to derive per-block IVs.
+func (f *reverseFile) header() []byte {
+	h := make([]byte, 0, reverseHeaderLen)
+	h = append(h, reverseHeaderVersion[:]...)
+	h = append(h, f.fileID...)
+	return h
+}
+
+// Read serves the ciphertext byte range [off, off+len(buf)), which may span
+// the synthetic header and/or any number of content blocks - FUSE reads up
+// to 128KiB per call, many multiples of the (usually 4KiB plaintext) block
+// size, so we can't assume a single block covers the request.
+func (f *reverseFile) Read(buf []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	var out []byte
+	remaining := int64(len(buf))
+	pos := off
+
+	// Header lives at ciphertext offset [0, reverseHeaderLen)
+	if pos < reverseHeaderLen && remaining > 0 {
+		h := f.header()
+		start := pos
+		end := start + remaining
+		if end > reverseHeaderLen {
+			end = reverseHeaderLen
+		}
+		out = append(out, h[start:end]...)
+		consumed := end - start
+		pos += consumed
+		remaining -= consumed
+	}
+
+	cipherBS := int64(f.contentEnc.CipherBS())
+	plainBS := int64(f.contentEnc.PlainBS())
+
+	for remaining > 0 {
+		relOff := pos - reverseHeaderLen
+		blockNo := uint64(relOff / cipherBS)
+		blockOff := relOff % cipherBS
+
+		plain := make([]byte, plainBS)
+		n, err := f.fd.ReadAt(plain, int64(blockNo)*plainBS)
+		if n == 0 {
+			if err != nil && err != io.EOF {
+				return nil, fuse.ToStatus(err)
+			}
+			// End of the plaintext file - nothing more to encrypt.
+			break
+		}
+		plain = plain[:n]
+		cBlock := f.contentEnc.EncryptBlock(plain, blockNo, f.fileID)
+
+		if blockOff < 0 || blockOff > int64(len(cBlock)) {
+			break
+		}
+		end := blockOff + remaining
+		if end > int64(len(cBlock)) {
+			end = int64(len(cBlock))
+		}
+		out = append(out, cBlock[blockOff:end]...)
+		consumed := end - blockOff
+		pos += consumed
+		remaining -= consumed
+
+		// Short read from the plaintext file means we just served its last
+		// block - stop instead of looping forever on the same offset.
+		if int64(n) < plainBS {
+			break
+		}
+	}
+
+	return fuse.ReadResultData(out), fuse.OK
+}
+
+func (f *reverseFile) Release() {
+	f.fd.Close()
+}
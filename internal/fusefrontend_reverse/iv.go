@@ -0,0 +1,30 @@
+package fusefrontend_reverse
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"syscall"
+
+	"github.com/rfjakob/gocryptfs/internal/contentenc"
+)
+
+// deriveFileID computes a deterministic per-file ID from the plaintext
+// inode number and the master key, instead of the random ID gocryptfs
+// normally stores in the file header. Reverse mode never writes a header,
+// so the ID - and with it every per-block IV contentEnc derives from it -
+// must be reproducible across mounts without any on-disk state.
+//
+// Using the inode number (rather than the path) means a renamed-but-not-
+// modified file still produces identical ciphertext, which matters for
+// incremental backup tools that compare content, not just names.
+func deriveFileID(masterkey []byte, fi os.FileInfo) []byte {
+	st := fi.Sys().(*syscall.Stat_t)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], st.Ino)
+
+	mac := hmac.New(sha256.New, masterkey)
+	mac.Write(buf[:])
+	return mac.Sum(nil)[:contentenc.DefaultIVBits/8]
+}
@@ -0,0 +1,60 @@
+package fusefrontend_reverse
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rfjakob/gocryptfs/internal/nametransform"
+)
+
+// longNameContent recomputes the full encrypted name that a
+// "gocryptfs.longname.*.name" virtual file stands in for.
+//
+// We cannot store the long name anywhere on disk (reverse mode never writes
+// to the plaintext tree), so we recompute it on the fly: re-encrypt every
+// entry of the parent plaintext directory and return whichever one hashes to
+// the name embedded in relPath.
+func (rfs *reverseFS) longNameContent(relPath string) ([]byte, error) {
+	cDir := path.Dir(relPath)
+	if cDir == "." {
+		cDir = ""
+	}
+	hash := strings.TrimSuffix(path.Base(relPath), nametransform.LongNameSuffix)
+
+	pDir, err := rfs.decryptPath(cDir)
+	if err != nil {
+		return nil, err
+	}
+	plainNames, err := rfs.readDirNames(pDir)
+	if err != nil {
+		return nil, err
+	}
+	// All entries of pDir share the same directory IV - look it up once
+	// instead of re-encrypting the whole path (and re-looking-up the IV)
+	// for every candidate.
+	iv := rfs.nameTransform.DirIVCache.Get(cDir)
+	for _, name := range plainNames {
+		cName := rfs.nameTransform.EncryptName(name, iv)
+		if nametransformIsTooLong(cName) && rfs.nameTransform.HashLongName(cName) == hash {
+			return []byte(cName), nil
+		}
+	}
+	return nil, fmt.Errorf("longNameContent: no entry in %q hashes to %q", pDir, hash)
+}
+
+// readDirNames lists the plaintext names directly under absolute-relative
+// path "pDir" (relative to args.Cipherdir, the plaintext tree root).
+func (rfs *reverseFS) readDirNames(pDir string) ([]string, error) {
+	absDir, err := rfs.abs(pDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(absDir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
@@ -0,0 +1,83 @@
+package fusefrontend_reverse
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// abs - turn the relative plaintext path "relPath" (and an error that may
+// already have occurred further up the call chain) into an absolute path
+// into the plaintext directory tree (args.Cipherdir for reverse mode, since
+// "cipherdir" is the plaintext side here).
+//
+// Passing "err" through lets callers write the common
+// "rfs.abs(rfs.encryptPath(relPath))" one-liner instead of checking the
+// error twice.
+func (rfs *reverseFS) abs(relPath string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(rfs.args.Cipherdir, relPath), nil
+}
+
+// decryptPath decrypts all path components of the ciphertext path "relPath"
+func (rfs *reverseFS) decryptPath(relPath string) (string, error) {
+	if relPath == "" {
+		return "", nil
+	}
+	parts := strings.Split(relPath, "/")
+	for i, part := range parts {
+		longPart, err := rfs.nameTransform.DecryptLongName(part, rfs.longNameDir(parts[:i]))
+		if err != nil {
+			return "", err
+		}
+		parts[i] = longPart
+	}
+	return filepath.Join(parts...), nil
+}
+
+// encryptPath encrypts all path components of the plaintext path "relPath"
+func (rfs *reverseFS) encryptPath(relPath string) (string, error) {
+	if relPath == "" {
+		return "", nil
+	}
+	parts := strings.Split(relPath, "/")
+	for i, part := range parts {
+		iv := rfs.nameTransform.DirIVCache.Get(rfs.longNameDir(parts[:i]))
+		parts[i] = rfs.nameTransform.EncryptName(part, iv)
+		if nametransformIsTooLong(parts[i]) {
+			parts[i] = rfs.nameTransform.HashLongName(parts[i])
+		}
+	}
+	return filepath.Join(parts...), nil
+}
+
+// longNameDir reconstructs the ciphertext directory a set of already-
+// encrypted path components lives in - used to look up the gocryptfs.diriv
+// belonging to that directory.
+func (rfs *reverseFS) longNameDir(parts []string) string {
+	return filepath.Join(parts...)
+}
+
+// nametransformIsTooLong reports whether an encrypted name needs to be
+// replaced by a gocryptfs.longname.* placeholder.
+func nametransformIsTooLong(name string) bool {
+	return len(name) > 255-len(".name")
+}
+
+// isFiltered decides if the ciphertext path relPath must not be visible in
+// the reverse mount: its decrypted path is ".gocryptfs.reverse.conf", a path
+// listed in that file, or lies below a listed directory. A relPath that does
+// not decrypt is not filtered.
+func (rfs *reverseFS) isFiltered(relPath string) bool {
+	pPath, err := rfs.decryptPath(relPath)
+	if err != nil {
+		return false
+	}
+	for _, e := range rfs.excludedPaths {
+		if pPath == e || strings.HasPrefix(pPath, e+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package fusefrontend_reverse
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReverseConfName is the name of the optional plaintext-side exclude list.
+// It lives next to the real files, one plaintext-relative path per line,
+// and is itself always hidden from the encrypted view.
+const ReverseConfName = ".gocryptfs.reverse.conf"
+
+// readReverseConf reads ReverseConfName out of "cipherdir" (the plaintext
+// tree root in reverse mode) and returns the list of excluded paths. A
+// missing file is not an error - most reverse mounts don't need one.
+func readReverseConf(cipherdir string) []string {
+	f, err := os.Open(filepath.Join(cipherdir, ReverseConfName))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var excluded []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		excluded = append(excluded, strings.TrimSuffix(line, "/"))
+	}
+	excluded = append(excluded, ReverseConfName)
+	return excluded
+}
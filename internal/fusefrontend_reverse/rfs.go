@@ -1,7 +1,6 @@
 package fusefrontend_reverse
 
 import (
-	"fmt"
 	"os"
 	"path"
 	"strings"
@@ -32,22 +31,31 @@ type reverseFS struct {
 	nameTransform *nametransform.NameTransform
 	// Content encryption helper
 	contentEnc *contentenc.ContentEnc
+	// Crypto primitives, needed directly (not just through contentEnc) for
+	// xattr name/value encryption
+	cryptoCore *cryptocore.CryptoCore
+	// Plaintext-relative paths that must not show up in the encrypted view,
+	// read from ".gocryptfs.reverse.conf" in the plaintext tree root
+	excludedPaths []string
 }
 
 // Encrypted FUSE overlay filesystem
 func NewFS(args fusefrontend.Args) *reverseFS {
-	cryptoCore := cryptocore.New(args.Masterkey, args.OpenSSL, true)
+	cryptoCore := cryptocore.New(args.Masterkey, args.OpenSSL, args.AESSIV)
 	contentEnc := contentenc.New(cryptoCore, contentenc.DefaultBS)
 	nameTransform := nametransform.New(cryptoCore, args.LongNames)
 
-	return &reverseFS{
+	rfs := &reverseFS{
 		// pathfs.defaultFileSystem returns ENOSYS for all operations
 		FileSystem:    pathfs.NewDefaultFileSystem(),
 		loopbackfs:    pathfs.NewLoopbackFileSystem(args.Cipherdir),
 		args:          args,
 		nameTransform: nameTransform,
 		contentEnc:    contentEnc,
+		cryptoCore:    cryptoCore,
 	}
+	rfs.excludedPaths = readReverseConf(args.Cipherdir)
+	return rfs
 }
 
 func (rfs *reverseFS) GetAttr(relPath string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
@@ -55,31 +63,25 @@ func (rfs *reverseFS) GetAttr(relPath string, context *fuse.Context) (*fuse.Attr
 	if relPath == nametransform.DirIVFilename ||
 		strings.HasSuffix(relPath, nametransform.DirIVFilename) {
 
-		fmt.Printf("Handling gocryptfs.diriv\n")
-
 		cDir := path.Dir(relPath)
 		if cDir == "." {
 			cDir = ""
 		}
 		dir, err := rfs.decryptPath(cDir)
 		if err != nil {
-			fmt.Printf("decrypt err %q\n", cDir)
 			return nil, fuse.ToStatus(err)
 		}
 		// Does the parent dir exist?
 		a, status := rfs.loopbackfs.GetAttr(dir, context)
 		if !status.Ok() {
-			fmt.Printf("missing parent\n")
 			return nil, status
 		}
 		// Is it a dir at all?
 		if !a.IsDir() {
-			fmt.Printf("not isdir\n")
 			return nil, fuse.ENOTDIR
 		}
 		// Does the user have execute permissions?
 		if a.Mode&syscall.S_IXUSR == 0 {
-			fmt.Printf("not exec")
 			return nil, fuse.EPERM
 		}
 		// All good. Let's fake the file.
@@ -91,6 +93,11 @@ func (rfs *reverseFS) GetAttr(relPath string, context *fuse.Context) (*fuse.Attr
 		return a, fuse.OK
 	}
 
+	// Handle gocryptfs.longname.*.name
+	if nametransform.IsLongNameFile(path.Base(relPath)) {
+		return rfs.getAttrLongNameFile(relPath, context)
+	}
+
 	if rfs.isFiltered(relPath) {
 		return nil, fuse.EPERM
 	}
@@ -109,6 +116,34 @@ func (rfs *reverseFS) GetAttr(relPath string, context *fuse.Context) (*fuse.Attr
 	return a, fuse.OK
 }
 
+// getAttrLongNameFile fakes up the attributes for a virtual
+// "gocryptfs.longname.*.name" auxiliary file. These hold the full encrypted
+// name of a directory entry whose own name was too long to store as a
+// regular ciphertext name, so they must exist wherever the long name's
+// sibling entry exists.
+func (rfs *reverseFS) getAttrLongNameFile(relPath string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	cDir := path.Dir(relPath)
+	if cDir == "." {
+		cDir = ""
+	}
+	dir, err := rfs.decryptPath(cDir)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	a, status := rfs.loopbackfs.GetAttr(dir, context)
+	if !status.Ok() {
+		return nil, status
+	}
+	content, err := rfs.longNameContent(relPath)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	a.Mode = DirIVMode
+	a.Size = uint64(len(content))
+	a.Nlink = 1
+	return a, fuse.OK
+}
+
 func (rfs *reverseFS) Access(relPath string, mode uint32, context *fuse.Context) fuse.Status {
 	if rfs.isFiltered(relPath) {
 		return fuse.EPERM
@@ -124,7 +159,20 @@ func (rfs *reverseFS) Open(relPath string, flags uint32, context *fuse.Context)
 	if rfs.isFiltered(relPath) {
 		return nil, fuse.EPERM
 	}
-	absPath, err := rfs.abs(rfs.decryptPath(relPath))
+	// Serve the encrypted name back out of a virtual
+	// "gocryptfs.longname.*.name" file
+	if nametransform.IsLongNameFile(path.Base(relPath)) {
+		content, err := rfs.longNameContent(relPath)
+		if err != nil {
+			return nil, fuse.ToStatus(err)
+		}
+		return nodefs.NewDataFile(content), fuse.OK
+	}
+	cPath, err := rfs.decryptPath(relPath)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	absPath, err := rfs.abs(cPath, nil)
 	if err != nil {
 		return nil, fuse.ToStatus(err)
 	}
@@ -132,7 +180,34 @@ func (rfs *reverseFS) Open(relPath string, flags uint32, context *fuse.Context)
 	if err != nil {
 		return nil, fuse.ToStatus(err)
 	}
-	return NewFile(f, rfs.contentEnc)
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fuse.ToStatus(err)
+	}
+	fileID := deriveFileID(rfs.args.Masterkey, fi)
+	return NewFile(f, rfs.contentEnc, fileID)
+}
+
+// Lookup implements the "stat(2) on a single path component" half of
+// readdir+stat that the kernel issues for every entry it has not cached yet.
+// GetAttr already does all the real work, so Lookup is a thin wrapper.
+func (rfs *reverseFS) Lookup(relPath string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	return rfs.GetAttr(relPath, context)
+}
+
+// Readlink decrypts the symlink target. Like regular file names, the target
+// is stored in the plaintext tree in the clear and only looks encrypted from
+// the mountpoint.
+func (rfs *reverseFS) Readlink(relPath string, context *fuse.Context) (string, fuse.Status) {
+	if rfs.isFiltered(relPath) {
+		return "", fuse.EPERM
+	}
+	cPath, err := rfs.decryptPath(relPath)
+	if err != nil {
+		return "", fuse.ToStatus(err)
+	}
+	return rfs.loopbackfs.Readlink(cPath, context)
 }
 
 func (rfs *reverseFS) OpenDir(relPath string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
@@ -145,15 +220,30 @@ func (rfs *reverseFS) OpenDir(relPath string, context *fuse.Context) ([]fuse.Dir
 	if entries == nil {
 		return nil, status
 	}
-	// Encrypt names
+	// Encrypt names, adding a gocryptfs.longname.* sibling for any entry
+	// whose encrypted name no longer fits into a single directory entry.
+	// All entries share the IV of this directory.
+	cDir, err := rfs.encryptPath(relPath)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	iv := rfs.nameTransform.DirIVCache.Get(cDir)
+	var longNameEntries []fuse.DirEntry
 	for i := range entries {
-		entries[i].Name, err = rfs.encryptPath(entries[i].Name)
-		if err != nil {
-			return nil, fuse.ToStatus(err)
+		cName := rfs.nameTransform.EncryptName(entries[i].Name, iv)
+		if nametransformIsTooLong(cName) {
+			hashed := rfs.nameTransform.HashLongName(cName)
+			longNameEntries = append(longNameEntries, fuse.DirEntry{
+				Mode: DirIVMode,
+				Name: hashed + nametransform.LongNameSuffix,
+			})
+			cName = hashed
 		}
+		entries[i].Name = cName
 	}
+	entries = append(entries, longNameEntries...)
 	// Add virtual gocryptfs.diriv
-	entries = append(entries, fuse.DirEntry{syscall.S_IFREG | 0400, nametransform.DirIVFilename})
+	entries = append(entries, fuse.DirEntry{Mode: syscall.S_IFREG | 0400, Name: nametransform.DirIVFilename})
 
 	return entries, fuse.OK
-}
\ No newline at end of file
+}
@@ -0,0 +1,161 @@
+package fusefrontend_reverse
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// xattrNamePrefix marks an encrypted attribute name, mirroring how
+// nametransform.LongNameSuffix marks an encrypted long file name.
+const xattrNamePrefix = "user.gocryptfs."
+
+// ListXAttr lists the real xattrs of the backing plaintext file, with each
+// name replaced by its encrypted form.
+func (rfs *reverseFS) ListXAttr(relPath string, context *fuse.Context) ([]string, fuse.Status) {
+	if rfs.isFiltered(relPath) {
+		return nil, fuse.EPERM
+	}
+	absPath, err := rfs.abs(rfs.decryptPath(relPath))
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	sz, err := syscall.Listxattr(absPath, nil)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	buf := make([]byte, sz)
+	n, err := syscall.Listxattr(absPath, buf)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	names := splitNulTerminated(buf[:n])
+	fi, err := rfs.statIno(absPath)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	encNames := make([]string, 0, len(names))
+	for _, name := range names {
+		encNames = append(encNames, rfs.encryptXAttrName(fi, name))
+	}
+	return encNames, fuse.OK
+}
+
+// GetXAttr decrypts "attribute" back to the real xattr name, reads the real
+// value, and returns nonce||ciphertext, AES-GCM-encrypted under a nonce
+// derived from the file's inode number and the real attribute name.
+// Re-deriving the nonce this way (instead of storing it) keeps ciphertext
+// byte-identical across mounts. The nonce is prepended, the same
+// nonce||ciphertext layout pathfs_frontend/xattr.go stores. The attribute
+// names differ from pathfs_frontend's, which encrypts them with the file name
+// encryption instead, so a forward mount layered on top of this view does not
+// find these attributes under the names it looks up.
+func (rfs *reverseFS) GetXAttr(relPath string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
+	if rfs.isFiltered(relPath) {
+		return nil, fuse.EPERM
+	}
+	absPath, err := rfs.abs(rfs.decryptPath(relPath))
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	fi, err := rfs.statIno(absPath)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	realName, err := rfs.findRealXAttrName(absPath, fi, attribute)
+	if err != nil {
+		return nil, fuse.ENOATTR
+	}
+	sz, err := syscall.Getxattr(absPath, realName, nil)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	value := make([]byte, sz)
+	n, err := syscall.Getxattr(absPath, realName, value)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	return rfs.encryptXAttrValue(fi, realName, value[:n]), fuse.OK
+}
+
+// SetXAttr and RemoveXAttr are no-ops: reverse mode never writes to the
+// plaintext tree.
+func (rfs *reverseFS) SetXAttr(relPath string, attribute string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	return fuse.EROFS
+}
+
+func (rfs *reverseFS) RemoveXAttr(relPath string, attribute string, context *fuse.Context) fuse.Status {
+	return fuse.EROFS
+}
+
+func (rfs *reverseFS) statIno(absPath string) (*syscall.Stat_t, error) {
+	var st syscall.Stat_t
+	if err := syscall.Lstat(absPath, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// xattrNonce derives a deterministic 96-bit GCM nonce from the file's inode
+// number and the real attribute name.
+func (rfs *reverseFS) xattrNonce(st *syscall.Stat_t, realName string) []byte {
+	mac := hmac.New(sha256.New, rfs.cryptoCore.EncryptKey)
+	var inoBuf [8]byte
+	for i := 0; i < 8; i++ {
+		inoBuf[i] = byte(st.Ino >> (8 * uint(i)))
+	}
+	mac.Write(inoBuf[:])
+	mac.Write([]byte(realName))
+	return mac.Sum(nil)[:12]
+}
+
+func (rfs *reverseFS) encryptXAttrValue(st *syscall.Stat_t, realName string, value []byte) []byte {
+	nonce := rfs.xattrNonce(st, realName)
+	return rfs.cryptoCore.AEADCipher.Seal(nonce, nonce, value, nil)
+}
+
+func (rfs *reverseFS) encryptXAttrName(st *syscall.Stat_t, realName string) string {
+	nonce := rfs.xattrNonce(st, realName)
+	ct := rfs.cryptoCore.AEADCipher.Seal(nil, nonce, []byte(realName), nil)
+	return xattrNamePrefix + base64.RawURLEncoding.EncodeToString(ct)
+}
+
+// findRealXAttrName recovers the real attribute name an encrypted
+// "user.gocryptfs.*" name stands for. Like longNameContent for
+// gocryptfs.longname.* files, this works by re-encrypting every candidate
+// (here: every real xattr on the file) and comparing, rather than by
+// decrypting - the name is authenticated (AES-GCM), not just obfuscated.
+func (rfs *reverseFS) findRealXAttrName(absPath string, st *syscall.Stat_t, attribute string) (string, error) {
+	sz, err := syscall.Listxattr(absPath, nil)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, sz)
+	n, err := syscall.Listxattr(absPath, buf)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range splitNulTerminated(buf[:n]) {
+		if rfs.encryptXAttrName(st, name) == attribute {
+			return name, nil
+		}
+	}
+	return "", syscall.ENODATA
+}
+
+func splitNulTerminated(buf []byte) []string {
+	var names []string
+	start := 0
+	for i, b := range buf {
+		if b == 0 {
+			if i > start {
+				names = append(names, string(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return names
+}
@@ -13,6 +13,9 @@ import (
 	"time"
 
 	"github.com/rfjakob/gocryptfs/cryptfs"
+	"github.com/rfjakob/gocryptfs/internal/fusefrontend"
+	"github.com/rfjakob/gocryptfs/internal/fusefrontend_reverse"
+	"github.com/rfjakob/gocryptfs/internal/logger"
 	"github.com/rfjakob/gocryptfs/pathfs_frontend"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -20,6 +23,20 @@ import (
 	"github.com/hanwen/go-fuse/fuse/pathfs"
 )
 
+// Info, Warn and Debug are the leveled loggers package main prints through.
+// They default to text-on-stderr and are reconfigured in main() once
+// "-log-format" and "-syslog" have been parsed. The cryptfs package prints
+// through its own cryptfs.Info/Warn/Debug, which these settings do not reach.
+var (
+	Info  = logger.New("info")
+	Warn  = logger.New("warning")
+	Debug = logger.New("debug")
+)
+
+func init() {
+	Debug.Disable()
+}
+
 const (
 	PROGRAM_NAME = "gocryptfs"
 
@@ -37,20 +54,33 @@ const (
 var GitVersion = "[version not set - please compile using ./build.bash]"
 
 func initDir(args *argContainer) {
-	err := checkDirEmpty(args.cipherdir)
-	if err != nil {
-		fmt.Printf("Invalid CIPHERDIR: %v\n", err)
-		os.Exit(ERREXIT_INIT)
+	// In "-reverse" mode, CIPHERDIR is actually the plaintext tree, and the
+	// config file must live outside of it - otherwise it would show up
+	// (encrypted) inside the reverse mount itself and get backed up along
+	// with everything else.
+	if !args.reverse {
+		err := checkDirEmpty(args.cipherdir)
+		if err != nil {
+			fmt.Printf("Invalid CIPHERDIR: %v\n", err)
+			os.Exit(ERREXIT_INIT)
+		}
+	} else {
+		// Reverse mode promises byte-identical ciphertext across mounts of
+		// the same tree. The block encryption reverse mode uses only holds
+		// that promise under AES-SIV, which derives its nonce from the
+		// plaintext instead of picking one at random - plain GCM would mean
+		// every Read() makes up new ciphertext.
+		args.aessiv = true
 	}
 
-	cryptfs.Info.Printf("Choose a password for protecting your files.\n")
+	Info.Printf("Choose a password for protecting your files.\n")
 	password := readPasswordTwice()
-	err = cryptfs.CreateConfFile(args.config, password, args.plaintextnames)
+	err := cryptfs.CreateConfFile(args.config, password, args.plaintextnames, args.aessiv)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(ERREXIT_INIT)
 	}
-	cryptfs.Info.Printf("The filesystem is now ready for mounting.\n")
+	Info.Printf("The filesystem is now ready for mounting.\n")
 	os.Exit(0)
 }
 
@@ -65,9 +95,12 @@ func usageText() {
 
 type argContainer struct {
 	debug, init, zerokey, fusedebug, openssl, passwd, foreground, version,
-	plaintextnames, quiet bool
-	masterkey, mountpoint, cipherdir, cpuprofile, config string
-	notifypid                                    int
+	plaintextnames, quiet, reverse, aessiv, allowOther, ro bool
+	masterkey, mountpoint, cipherdir, cpuprofile, config,
+	logFormat, ctlsock string
+	syslog    bool
+	notifypid int
+	idle      time.Duration
 }
 
 var flagSet *flag.FlagSet
@@ -82,7 +115,7 @@ func loadConfig(filename string) (masterkey []byte, confFile *cryptfs.ConfFile)
 	}
 	fmt.Printf("Password: ")
 	pw := readPassword()
-	cryptfs.Info.Printf("Decrypting master key... ")
+	Info.Printf("Decrypting master key... ")
 	cryptfs.Warn.Disable() // Silence DecryptBlock() error messages on incorrect password
 	masterkey, confFile, err = cryptfs.LoadConfFile(filename, pw)
 	cryptfs.Warn.Enable()
@@ -91,7 +124,7 @@ func loadConfig(filename string) (masterkey []byte, confFile *cryptfs.ConfFile)
 		fmt.Println("Wrong password.")
 		os.Exit(ERREXIT_LOADCONF)
 	}
-	cryptfs.Info.Printf("done.\n")
+	Info.Printf("done.\n")
 
 	return masterkey, confFile
 }
@@ -107,7 +140,7 @@ func changePassword(filename string) {
 		fmt.Println(err)
 		os.Exit(ERREXIT_INIT)
 	}
-	cryptfs.Info.Printf("Password changed.\n")
+	Info.Printf("Password changed.\n")
 	os.Exit(0)
 }
 
@@ -136,6 +169,20 @@ func main() {
 	flagSet.BoolVar(&args.plaintextnames, "plaintextnames", false, "Do not encrypt "+
 		"file names - can only be used together with -init")
 	flagSet.BoolVar(&args.quiet, "q", false, "Quiet - silence informational messages")
+	flagSet.BoolVar(&args.reverse, "reverse", false, "Reverse mode: present CIPHERDIR, a plaintext "+
+		"directory, as an encrypted view at MOUNTPOINT")
+	flagSet.BoolVar(&args.aessiv, "aessiv", false, "Use AES-SIV for deterministic, authenticated "+
+		"encryption - required for, and only meaningful with, -reverse")
+	flagSet.BoolVar(&args.allowOther, "allow_other", false, "Allow other users to access the mount "+
+		"(via the FUSE \"allow_other\" option; needs \"user_allow_other\" in /etc/fuse.conf)")
+	flagSet.BoolVar(&args.ro, "ro", false, "Mount read-only")
+	flagSet.DurationVar(&args.idle, "idle", 0, "Auto-unmount after this long without FUSE lookup, "+
+		"getattr, open, read, write or readdir requests, e.g. \"-idle=30m\". Zero (the default) "+
+		"disables the idle timer.")
+	flagSet.StringVar(&args.logFormat, "log-format", "text", "Log message format, \"text\" or \"json\"")
+	flagSet.BoolVar(&args.syslog, "syslog", false, "Log to syslog instead of stderr")
+	flagSet.StringVar(&args.ctlsock, "ctlsock", "", "Open a control socket at PATH after mounting, "+
+		"accepting {\"EncryptPath\":...}/{\"DecryptPath\":...}/{\"Stats\":true}/{\"Unmount\":true} requests")
 	flagSet.StringVar(&args.masterkey, "masterkey", "", "Mount with explicit master key")
 	flagSet.StringVar(&args.cpuprofile, "cpuprofile", "", "Write cpu profile to specified file")
 	flagSet.StringVar(&args.config, "config", "", "Use specified config file instead of CIPHERDIR/gocryptfs.conf")
@@ -143,9 +190,21 @@ func main() {
 		"successful mount - used internally for daemonization")
 	flagSet.Parse(os.Args[1:])
 
+	logFormat := logger.FormatText
+	if args.logFormat == "json" {
+		logFormat = logger.FormatJSON
+	} else if args.logFormat != "text" {
+		fmt.Printf("Invalid \"-log-format\" value %q: must be \"text\" or \"json\"\n", args.logFormat)
+		os.Exit(ERREXIT_USAGE)
+	}
+	if err := logger.Configure([]*logger.Logger{Info, Warn, Debug}, logFormat, args.syslog); err != nil {
+		fmt.Println(err)
+		os.Exit(ERREXIT_USAGE)
+	}
+
 	if args.debug {
-		cryptfs.Debug.Enable()
-		cryptfs.Debug.Printf("Debug output enabled\n")
+		Debug.Enable()
+		Debug.Printf("Debug output enabled\n")
 	}
 	// By default, let the child handle everything.
 	// The parent *could* handle operations that do not require backgrounding by
@@ -173,7 +232,7 @@ func main() {
 	}
 	// "-q"
 	if args.quiet {
-		cryptfs.Info.Disable()
+		Info.Disable()
 	}
 	// "-config"
 	if args.config != "" {
@@ -181,7 +240,14 @@ func main() {
 		if err != nil {
 			fmt.Printf("Invalid \"-config\" setting: %v\n", err)
 		}
-		cryptfs.Info.Printf("Using config file at custom location %s\n", args.config)
+		Info.Printf("Using config file at custom location %s\n", args.config)
+	} else if args.reverse {
+		// The plaintext tree must never contain the config file - it would
+		// otherwise appear (encrypted) inside the reverse mount and get
+		// swept up by whatever is backing the mount up. Default to a sibling
+		// file named "<cipherdir-basename>.gocryptfs.conf" next to it, e.g.
+		// "/home/user/Documents" -> "/home/user/Documents.gocryptfs.conf".
+		args.config = filepath.Join(filepath.Dir(args.cipherdir), filepath.Base(args.cipherdir)+".gocryptfs.conf")
 	} else {
 		args.config = filepath.Join(args.cipherdir, cryptfs.ConfDefaultName)
 	}
@@ -192,13 +258,13 @@ func main() {
 			fmt.Println(err)
 			os.Exit(ERREXIT_INIT)
 		}
-		cryptfs.Info.Printf("Writing CPU profile to %s\n", args.cpuprofile)
+		Info.Printf("Writing CPU profile to %s\n", args.cpuprofile)
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
 	// "-openssl"
 	if args.openssl == false {
-		cryptfs.Info.Printf("Openssl disabled\n")
+		Info.Printf("Openssl disabled\n")
 	}
 	// Operation flags: init, passwd or mount
 	// "-init"
@@ -237,13 +303,13 @@ func main() {
 	var masterkey []byte
 	if args.masterkey != "" {
 		// "-masterkey"
-		cryptfs.Info.Printf("Using explicit master key.\n")
+		Info.Printf("Using explicit master key.\n")
 		masterkey = parseMasterKey(args.masterkey)
-		cryptfs.Info.Printf("THE MASTER KEY IS VISIBLE VIA \"ps -auxwww\", ONLY USE THIS MODE FOR EMERGENCIES.\n")
+		Info.Printf("THE MASTER KEY IS VISIBLE VIA \"ps -auxwww\", ONLY USE THIS MODE FOR EMERGENCIES.\n")
 	} else if args.zerokey {
 		// "-zerokey"
-		cryptfs.Info.Printf("Using all-zero dummy master key.\n")
-		cryptfs.Info.Printf("ZEROKEY MODE PROVIDES NO SECURITY AT ALL AND SHOULD ONLY BE USED FOR TESTING.\n")
+		Info.Printf("Using all-zero dummy master key.\n")
+		Info.Printf("ZEROKEY MODE PROVIDES NO SECURITY AT ALL AND SHOULD ONLY BE USED FOR TESTING.\n")
 		masterkey = make([]byte, cryptfs.KEY_LEN)
 	} else {
 		// Load master key from config file
@@ -251,10 +317,36 @@ func main() {
 		masterkey, confFile = loadConfig(args.config)
 		printMasterKey(masterkey)
 		args.plaintextnames = confFile.PlaintextNames()
+		// Take "-aessiv" from the config rather than from the command line.
+		// Only reverseFrontend passes it on, and the block below forces it
+		// on for reverse mounts anyway; pathfs_frontend.NewFS never enables
+		// AES-SIV, whatever the config says.
+		args.aessiv = confFile.AESSIV()
+	}
+	// Reverse mode's reproducible-ciphertext guarantee depends on AES-SIV;
+	// it isn't a matter of what the tree was -init'd with; force it on
+	// regardless of what the config says or what "-aessiv" was passed as.
+	if args.reverse {
+		args.aessiv = true
 	}
 	// Initialize FUSE server
-	srv := pathfsFrontend(masterkey, args.cipherdir, args.mountpoint, args.fusedebug, args.openssl, args.plaintextnames)
-	cryptfs.Info.Println("Filesystem ready.")
+	var srv *fuse.Server
+	var backend ctlSockBackend
+	if args.reverse {
+		srv, backend = reverseFrontend(masterkey, &args)
+	} else {
+		srv, backend = pathfsFrontend(masterkey, &args)
+	}
+	// "-ctlsock"
+	if args.ctlsock != "" {
+		err = serveCtlSock(args.ctlsock, backend, srv)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(ERREXIT_MOUNT)
+		}
+		Info.Printf("Control socket listening at %s\n", args.ctlsock)
+	}
+	Info.Println("Filesystem ready.")
 	// We are ready - send USR1 signal to our parent
 	if args.notifypid > 0 {
 		sendUsr1(args.notifypid)
@@ -269,10 +361,8 @@ func main() {
 
 // pathfsFrontend - initialize FUSE server based on go-fuse's PathFS
 // Calls os.Exit on errors
-func pathfsFrontend(key []byte, cipherdir string, mountpoint string,
-	debug bool, openssl bool, plaintextNames bool) *fuse.Server {
-
-	finalFs := pathfs_frontend.NewFS(key, cipherdir, openssl, plaintextNames)
+func pathfsFrontend(key []byte, args *argContainer) (*fuse.Server, ctlSockBackend) {
+	finalFs := pathfs_frontend.NewFS(key, args.cipherdir, args.openssl, args.plaintextnames, args.allowOther)
 	pathFsOpts := &pathfs.PathNodeFsOptions{ClientInodes: true}
 	pathFs := pathfs.NewPathNodeFs(finalFs, pathFsOpts)
 	fuseOpts := &nodefs.Options{
@@ -284,21 +374,82 @@ func pathfsFrontend(key []byte, cipherdir string, mountpoint string,
 	}
 	conn := nodefs.NewFileSystemConnector(pathFs.Root(), fuseOpts)
 	var mOpts fuse.MountOptions
-	mOpts.AllowOther = false
+	mOpts.AllowOther = args.allowOther
+	if args.ro {
+		mOpts.Options = append(mOpts.Options, "ro")
+	}
 	// Set values shown in "df -T" and friends
 	// First column, "Filesystem"
-	mOpts.Options = append(mOpts.Options, "fsname="+cipherdir)
+	mOpts.Options = append(mOpts.Options, "fsname="+args.cipherdir)
 	// Second column, "Type", will be shown as "fuse." + Name
 	mOpts.Name = "gocryptfs"
 
-	srv, err := fuse.NewServer(conn.RawFS(), mountpoint, &mOpts)
+	rawFS := conn.RawFS()
+	var monitorFS *idleMonitorFS
+	if args.idle > 0 {
+		monitorFS = newIdleMonitorFS(rawFS)
+		rawFS = monitorFS
+	}
+
+	srv, err := fuse.NewServer(rawFS, args.mountpoint, &mOpts)
 	if err != nil {
 		fmt.Printf("Mount failed: %v", err)
 		os.Exit(ERREXIT_MOUNT)
 	}
-	srv.SetDebug(debug)
+	srv.SetDebug(args.fusedebug)
+	if monitorFS != nil {
+		startIdleMonitor(monitorFS, srv, args.idle)
+	}
+
+	return srv, finalFs
+}
+
+// reverseFrontend - initialize FUSE server in reverse mode, presenting
+// args.cipherdir (a plaintext directory) as an encrypted view
+// Calls os.Exit on errors
+func reverseFrontend(key []byte, args *argContainer) (*fuse.Server, ctlSockBackend) {
+	fsArgs := fusefrontend.Args{
+		Cipherdir:      args.cipherdir,
+		Masterkey:      key,
+		OpenSSL:        args.openssl,
+		PlaintextNames: args.plaintextnames,
+		LongNames:      true,
+		AESSIV:         args.aessiv,
+	}
+	finalFs := fusefrontend_reverse.NewFS(fsArgs)
+	pathFsOpts := &pathfs.PathNodeFsOptions{ClientInodes: true}
+	pathFs := pathfs.NewPathNodeFs(finalFs, pathFsOpts)
+	fuseOpts := &nodefs.Options{
+		NegativeTimeout: time.Second,
+		AttrTimeout:     time.Second,
+		EntryTimeout:    time.Second,
+	}
+	conn := nodefs.NewFileSystemConnector(pathFs.Root(), fuseOpts)
+	var mOpts fuse.MountOptions
+	mOpts.AllowOther = args.allowOther
+	// Reverse mounts only ever need to be read from, never written to
+	mOpts.Options = append(mOpts.Options, "ro")
+	mOpts.Options = append(mOpts.Options, "fsname="+args.cipherdir)
+	mOpts.Name = "gocryptfs-reverse"
+
+	rawFS := conn.RawFS()
+	var monitorFS *idleMonitorFS
+	if args.idle > 0 {
+		monitorFS = newIdleMonitorFS(rawFS)
+		rawFS = monitorFS
+	}
+
+	srv, err := fuse.NewServer(rawFS, args.mountpoint, &mOpts)
+	if err != nil {
+		fmt.Printf("Mount failed: %v", err)
+		os.Exit(ERREXIT_MOUNT)
+	}
+	srv.SetDebug(args.fusedebug)
+	if monitorFS != nil {
+		startIdleMonitor(monitorFS, srv, args.idle)
+	}
 
-	return srv
+	return srv, finalFs
 }
 
 func handleSigint(srv *fuse.Server, mountpoint string) {
@@ -310,7 +461,7 @@ func handleSigint(srv *fuse.Server, mountpoint string) {
 		err := srv.Unmount()
 		if err != nil {
 			fmt.Print(err)
-			cryptfs.Info.Printf("Trying lazy unmount\n")
+			Info.Printf("Trying lazy unmount\n")
 			cmd := exec.Command("fusermount", "-u", "-z", mountpoint)
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
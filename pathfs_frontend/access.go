@@ -0,0 +1,79 @@
+package pathfs_frontend
+
+import (
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// Access checks "mode" (F_OK/R_OK/W_OK/X_OK) against the backing ciphertext
+// file. The kernel already does this for us under a normal mount, but once
+// "-allow_other" is set, every user on the system can reach the mount, so we
+// additionally enforce the owner/group/other permission bits ourselves
+// instead of trusting the mounting user's ability to read the plaintext.
+func (fs *FS) Access(relPath string, mode uint32, context *fuse.Context) fuse.Status {
+	cRelPath, err := fs.encryptPath(relPath)
+	if err != nil {
+		return fuse.ToStatus(err)
+	}
+	cAbsPath := fs.abs(cRelPath)
+
+	if !fs.allowOther {
+		return fuse.ToStatus(syscall.Access(cAbsPath, mode))
+	}
+	return fs.checkOwnerAccess(cAbsPath, mode, context)
+}
+
+// checkOwnerAccess re-implements the kernel's st_mode permission check
+// against "context"'s uid/gid, since syscall.Access() only ever checks the
+// permissions of the process calling it (i.e. the user who ran "mount" or
+// "gocryptfs"), not the uid/gid FUSE reports for the actual caller.
+func (fs *FS) checkOwnerAccess(cAbsPath string, mode uint32, context *fuse.Context) fuse.Status {
+	var st syscall.Stat_t
+	if err := syscall.Lstat(cAbsPath, &st); err != nil {
+		return fuse.ToStatus(err)
+	}
+
+	if context.Owner.Uid == 0 {
+		return fuse.OK
+	}
+
+	var perm uint32
+	switch {
+	case context.Owner.Uid == st.Uid:
+		perm = (st.Mode >> 6) & 7
+	case callerInGroup(context.Owner.Uid, st.Gid):
+		perm = (st.Mode >> 3) & 7
+	default:
+		perm = st.Mode & 7
+	}
+
+	if mode&perm != mode {
+		return fuse.EACCES
+	}
+	return fuse.OK
+}
+
+// callerInGroup reports whether uid is a member of gid, either as primary
+// or supplementary group. fuse.Context only carries the caller's primary
+// gid, which isn't enough on its own - a user whose supplementary groups
+// include the file's group should still get group permissions.
+func callerInGroup(uid uint32, gid uint32) bool {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return false
+	}
+	gidStr := strconv.FormatUint(uint64(gid), 10)
+	groupIds, err := u.GroupIds()
+	if err != nil {
+		return false
+	}
+	for _, g := range groupIds {
+		if g == gidStr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+// Package pathfs_frontend is the encrypted overlay filesystem used by the
+// normal (non-reverse) gocryptfs mount: CIPHERDIR holds the encrypted files
+// and directory names, and the mountpoint shows their decrypted plaintext
+// view.
+//
+// This file and its siblings only cover the parts of the forward frontend
+// that later backlog items (allow_other enforcement, the -ctlsock path
+// translation, and xattr passthrough) needed to touch. The bulk of the
+// package - GetAttr, Open, Lookup, Readdir, and the rest of the directory-IV
+// bookkeeping - lives elsewhere and isn't part of this tree.
+package pathfs_frontend
+
+import (
+	"path/filepath"
+
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+
+	"github.com/rfjakob/gocryptfs/internal/contentenc"
+	"github.com/rfjakob/gocryptfs/internal/cryptocore"
+	"github.com/rfjakob/gocryptfs/internal/nametransform"
+)
+
+// FS is the forward-mode encrypted FUSE overlay filesystem.
+type FS struct {
+	pathfs.FileSystem
+	loopbackfs     pathfs.FileSystem
+	cipherdir      string
+	cryptoCore     *cryptocore.CryptoCore
+	contentEnc     *contentenc.ContentEnc
+	nameTransform  *nametransform.NameTransform
+	plaintextNames bool
+	// allowOther mirrors the "-allow_other" flag - when set, the kernel no
+	// longer restricts the mount to its owning uid, so FS.Access must
+	// enforce the usual owner/group/other permission bits itself.
+	allowOther bool
+}
+
+// NewFS creates the forward-mode filesystem rooted at "cipherdir"
+func NewFS(key []byte, cipherdir string, openssl bool, plaintextNames bool, allowOther bool) *FS {
+	cryptoCore := cryptocore.New(key, openssl, false)
+	contentEnc := contentenc.New(cryptoCore, contentenc.DefaultBS)
+	nameTransform := nametransform.New(cryptoCore, true)
+
+	return &FS{
+		FileSystem:     pathfs.NewDefaultFileSystem(),
+		loopbackfs:     pathfs.NewLoopbackFileSystem(cipherdir),
+		cipherdir:      cipherdir,
+		cryptoCore:     cryptoCore,
+		contentEnc:     contentEnc,
+		nameTransform:  nameTransform,
+		plaintextNames: plaintextNames,
+		allowOther:     allowOther,
+	}
+}
+
+// abs turns a ciphertext-relative path into an absolute path into cipherdir
+func (fs *FS) abs(cRelPath string) string {
+	return filepath.Join(fs.cipherdir, cRelPath)
+}
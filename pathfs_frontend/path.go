@@ -0,0 +1,50 @@
+package pathfs_frontend
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// decryptPath decrypts all path components of the ciphertext-relative path
+// "cRelPath", the inverse of encryptPath.
+func (fs *FS) decryptPath(cRelPath string) (string, error) {
+	if cRelPath == "" {
+		return "", nil
+	}
+	parts := strings.Split(cRelPath, "/")
+	for i, part := range parts {
+		cDir := filepath.Join(parts[:i]...)
+		longPart, err := fs.nameTransform.DecryptLongName(part, fs.abs(cDir))
+		if err != nil {
+			return "", err
+		}
+		parts[i] = longPart
+	}
+	return filepath.Join(parts...), nil
+}
+
+// encryptPath encrypts all path components of the plaintext-relative path
+// "relPath".
+func (fs *FS) encryptPath(relPath string) (string, error) {
+	if relPath == "" {
+		return "", nil
+	}
+	parts := strings.Split(relPath, "/")
+	for i, part := range parts {
+		cDir := filepath.Join(parts[:i]...)
+		iv := fs.nameTransform.DirIVCache.Get(fs.abs(cDir))
+		parts[i] = fs.nameTransform.EncryptName(part, iv)
+	}
+	return filepath.Join(parts...), nil
+}
+
+// EncryptPath translates a plaintext-relative path into its on-disk,
+// encrypted counterpart. Exported for the "-ctlsock" control socket.
+func (fs *FS) EncryptPath(relPath string) (string, error) {
+	return fs.encryptPath(relPath)
+}
+
+// DecryptPath is the inverse of EncryptPath.
+func (fs *FS) DecryptPath(cRelPath string) (string, error) {
+	return fs.decryptPath(cRelPath)
+}
@@ -0,0 +1,19 @@
+package pathfs_frontend
+
+// Stats reports a few facts about this forward mount for the "-ctlsock"
+// "Stats" request.
+func (fs *FS) Stats() map[string]string {
+	return map[string]string{
+		"Mode":           "forward",
+		"Cipherdir":      fs.cipherdir,
+		"PlaintextNames": boolString(fs.plaintextNames),
+		"AllowOther":     boolString(fs.allowOther),
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,150 @@
+package pathfs_frontend
+
+import (
+	"crypto/rand"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// xattrNamePrefix marks an encrypted attribute name.
+const xattrNamePrefix = "user.gocryptfs."
+
+// xattrNameIV is the (fixed, all-zero) IV used to encrypt xattr names.
+// File name encryption normally uses a per-directory IV so that the same
+// plaintext name encrypts differently in different directories, but an
+// xattr name isn't part of a directory - it's just a key attached to one
+// file - so there is no per-directory IV to look up here.
+var xattrNameIV = make([]byte, 16)
+
+// xattrNonceLen is the size of the random GCM nonce we prepend to every
+// stored value. Unlike reverse mode, which has to re-derive the same nonce
+// on every mount to keep ciphertext reproducible, the forward mount owns the
+// on-disk state, so a fresh random nonce per Setxattr is simpler and avoids
+// ever reusing a nonce under the same key.
+const xattrNonceLen = 12
+
+// ListXAttr returns the backing file's on-disk (encrypted) xattr names,
+// each translated back to the plaintext name the caller set it under.
+func (fs *FS) ListXAttr(relPath string, context *fuse.Context) ([]string, fuse.Status) {
+	cAbsPath, status := fs.cAbsPath(relPath)
+	if !status.Ok() {
+		return nil, status
+	}
+	sz, err := syscall.Listxattr(cAbsPath, nil)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	buf := make([]byte, sz)
+	n, err := syscall.Listxattr(cAbsPath, buf)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	var out []string
+	for _, encName := range splitNulTerminated(buf[:n]) {
+		name, err := fs.decryptXAttrName(encName)
+		if err != nil {
+			// Not one of ours (e.g. "security.selinux") - skip it rather
+			// than exposing the raw on-disk name.
+			continue
+		}
+		out = append(out, name)
+	}
+	return out, fuse.OK
+}
+
+// GetXAttr encrypts "attribute" to find the on-disk name, reads the stored
+// value, strips the nonce off the front and decrypts the rest.
+func (fs *FS) GetXAttr(relPath string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
+	cAbsPath, status := fs.cAbsPath(relPath)
+	if !status.Ok() {
+		return nil, status
+	}
+	encName := fs.encryptXAttrName(attribute)
+	sz, err := syscall.Getxattr(cAbsPath, encName, nil)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	stored := make([]byte, sz)
+	n, err := syscall.Getxattr(cAbsPath, encName, stored)
+	if err != nil {
+		return nil, fuse.ToStatus(err)
+	}
+	stored = stored[:n]
+	if len(stored) < xattrNonceLen {
+		return nil, fuse.EIO
+	}
+	nonce, ciphertext := stored[:xattrNonceLen], stored[xattrNonceLen:]
+	plain, err := fs.cryptoCore.AEADCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fuse.EIO
+	}
+	return plain, fuse.OK
+}
+
+// SetXAttr encrypts "data" under a fresh random nonce and stores
+// nonce||ciphertext under the encrypted form of "attribute".
+func (fs *FS) SetXAttr(relPath string, attribute string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	cAbsPath, status := fs.cAbsPath(relPath)
+	if !status.Ok() {
+		return status
+	}
+	encName := fs.encryptXAttrName(attribute)
+	nonce := make([]byte, xattrNonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return fuse.ToStatus(err)
+	}
+	stored := fs.cryptoCore.AEADCipher.Seal(nonce, nonce, data, nil)
+	return fuse.ToStatus(syscall.Setxattr(cAbsPath, encName, stored, flags))
+}
+
+// RemoveXAttr encrypts "attribute" to find the on-disk name and removes it.
+func (fs *FS) RemoveXAttr(relPath string, attribute string, context *fuse.Context) fuse.Status {
+	cAbsPath, status := fs.cAbsPath(relPath)
+	if !status.Ok() {
+		return status
+	}
+	encName := fs.encryptXAttrName(attribute)
+	return fuse.ToStatus(syscall.Removexattr(cAbsPath, encName))
+}
+
+// cAbsPath encrypts relPath and joins it onto cipherdir, the pattern every
+// xattr method above needs first.
+func (fs *FS) cAbsPath(relPath string) (string, fuse.Status) {
+	cRelPath, err := fs.encryptPath(relPath)
+	if err != nil {
+		return "", fuse.ToStatus(err)
+	}
+	return fs.abs(cRelPath), fuse.OK
+}
+
+// encryptXAttrName deterministically encrypts a real attribute name the same
+// way a plaintext file name would be, so the same name always maps to the
+// same encrypted name regardless of which file it's attached to.
+func (fs *FS) encryptXAttrName(realName string) string {
+	ct := fs.nameTransform.EncryptName(realName, xattrNameIV)
+	return xattrNamePrefix + ct
+}
+
+// decryptXAttrName is the inverse of encryptXAttrName.
+func (fs *FS) decryptXAttrName(attribute string) (string, error) {
+	if !strings.HasPrefix(attribute, xattrNamePrefix) {
+		return "", syscall.EINVAL
+	}
+	return fs.nameTransform.DecryptName(attribute[len(xattrNamePrefix):], xattrNameIV)
+}
+
+func splitNulTerminated(buf []byte) []string {
+	var names []string
+	start := 0
+	for i, b := range buf {
+		if b == 0 {
+			if i > start {
+				names = append(names, string(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return names
+}
@@ -0,0 +1,90 @@
+package pathfs_frontend
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// TestXAttrRoundtrip covers the encrypt-on-write/decrypt-on-read xattr path,
+// including an empty value and one just under the kernel's 64KB xattr
+// value limit, with room left for the nonce and GCM tag SetXAttr adds - a
+// fixed-size buffer bug in either direction would only show up past the
+// first GCM block or on a zero-length Seal.
+func TestXAttrRoundtrip(t *testing.T) {
+	cipherDir, err := ioutil.TempDir("", "gocryptfs-xattr-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cipherDir)
+
+	masterkey := make([]byte, 32)
+	rand.Read(masterkey)
+	fs := NewFS(masterkey, cipherDir, false, false, false)
+
+	// The backing file lives in cipherDir under its encrypted name, which is
+	// where the xattr methods look for it.
+	plainFile := "xattrfile"
+	cRelPath, err := fs.encryptPath(plainFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cAbsPath := fs.abs(cRelPath)
+	if err := ioutil.WriteFile(cAbsPath, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave room under the kernel's 64KB xattr value limit for the
+	// xattrNonceLen-byte nonce and the GCM tag SetXAttr adds on top.
+	big := make([]byte, 64*1024-64)
+	rand.Read(big)
+
+	values := map[string][]byte{
+		"user.empty": {},
+		"user.small": []byte("hello"),
+		"user.big":   big,
+	}
+
+	ctx := &fuse.Context{}
+	for name, value := range values {
+		// A real FUSE caller on the mountpoint uses the plaintext name
+		// ("user.small"), never the encrypted on-disk form.
+		status := fs.SetXAttr(plainFile, name, value, 0, ctx)
+		if !status.Ok() {
+			t.Fatalf("SetXAttr(%s): %v", name, status)
+		}
+
+		// The value must actually be stored under the encrypted name.
+		encName := fs.encryptXAttrName(name)
+		if sz, err := syscall.Getxattr(cAbsPath, encName, nil); err != nil || sz <= 0 {
+			t.Fatalf("%s: not stored under its encrypted name %q: sz=%d err=%v", name, encName, sz, err)
+		}
+
+		got, status := fs.GetXAttr(plainFile, name, ctx)
+		if !status.Ok() {
+			t.Fatalf("GetXAttr(%s): %v", name, status)
+		}
+		if !bytes.Equal(got, value) {
+			t.Errorf("%s: roundtrip mismatch: got %d bytes, want %d bytes", name, len(got), len(value))
+		}
+	}
+
+	names, status := fs.ListXAttr(plainFile, ctx)
+	if !status.Ok() {
+		t.Fatalf("ListXAttr: %v", status)
+	}
+	seen := make(map[string]bool)
+	for _, n := range names {
+		seen[n] = true
+	}
+	for name := range values {
+		if !seen[name] {
+			t.Errorf("ListXAttr: missing %q, got %v", name, names)
+		}
+	}
+}